@@ -7,18 +7,23 @@ These functions are meant to be used during CI tests.
 */
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
+	"golang.org/x/mod/semver"
+
+	"github.com/gemnasium/toolbelt/autoupdate/vcs"
 	"github.com/gemnasium/toolbelt/config"
+	cfgautoupdate "github.com/gemnasium/toolbelt/config/autoupdate"
 	"github.com/gemnasium/toolbelt/gemnasium"
 	"github.com/gemnasium/toolbelt/models"
-	"github.com/gemnasium/toolbelt/utils"
+	"github.com/gemnasium/toolbelt/vcs/repo"
 )
 
 const (
@@ -26,6 +31,7 @@ const (
 	UPDATE_SET_INVALID      = "invalid"
 	UPDATE_SET_SUCCESS      = "test_passed"
 	UPDATE_SET_FAIL         = "test_failed"
+	UPDATE_SET_SKIPPED      = "skipped"
 )
 
 type RequirementUpdate struct {
@@ -53,13 +59,41 @@ type UpdateSetResult struct {
 }
 
 // Download and loop over update sets, apply changes, run test suite, and finally notify gemnasium
-func Run(projectSlug string, testSuite []string) error {
+//
+// jobs sets how many UpdateSets are tested concurrently, each in its own git
+// worktree; jobs <= 1 keeps the original one-at-a-time behavior.
+func Run(projectSlug string, testSuite []string, jobs int) error {
 	if envTS := os.Getenv(config.ENV_GEMNASIUM_TESTSUITE); envTS != "" {
 		testSuite = strings.Fields(envTS)
 	}
 	if len(testSuite) == 0 {
 		return errors.New("Arg [testSuite] can't be empty")
 	}
+	if envJobs := os.Getenv(config.ENV_GEMNASIUM_AUTOUPDATE_JOBS); envJobs != "" {
+		n, err := strconv.Atoi(envJobs)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", config.ENV_GEMNASIUM_AUTOUPDATE_JOBS, envJobs)
+		}
+		jobs = n
+	}
+
+	scopeConfig, err := cfgautoupdate.Load(cfgautoupdate.DefaultPath)
+	if err != nil {
+		return err
+	}
+
+	localRepo, err := repo.Open(".")
+	if err != nil {
+		return err
+	}
+	checkpoint, err := localRepo.HeadRevision()
+	if err != nil {
+		return err
+	}
+	baseBranch, err := localRepo.CurrentBranch()
+	if err != nil {
+		return err
+	}
 
 	fmt.Printf("Executing test script: ")
 	out, err := executeTestSuite(testSuite)
@@ -69,6 +103,12 @@ func Run(projectSlug string, testSuite []string) error {
 		return err
 	}
 
+	if jobs > 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), AUTOUPDATE_MAX_DURATION*time.Second)
+		defer cancel()
+		return runConcurrent(ctx, projectSlug, testSuite, jobs, localRepo, checkpoint, baseBranch, scopeConfig)
+	}
+
 	// We'll be checking loop duration on each iteration
 	startTime := time.Now()
 	// Loop until tests are green
@@ -77,10 +117,17 @@ func Run(projectSlug string, testSuite []string) error {
 			fmt.Println("Max loop duration reached, aborting.")
 			break
 		}
-		updateSet, err := fetchUpdateSet(projectSlug)
+		// Always start the iteration from the checkpoint: a hard reset is
+		// atomic and doesn't depend on knowing which files a previous
+		// iteration touched.
+		if err := localRepo.ResetHard(checkpoint); err != nil {
+			return err
+		}
+
+		updateSet, err := fetchUpdateSet(projectSlug, checkpoint, baseBranch)
 		if err != nil {
 			if err.Error() == "Server returned non-200 status: 409 Conflict\n" {
-				fmt.Printf("The current revision (%s) is unknown on Gemnasium, please push your dependency files before running autoupdate.\nSee `gemnasium df help push`.\n", utils.GetCurrentRevision())
+				fmt.Printf("The current revision (%s) is unknown on Gemnasium, please push your dependency files before running autoupdate.\nSee `gemnasium df help push`.\n", checkpoint)
 			}
 			return err
 		}
@@ -90,20 +137,33 @@ func Run(projectSlug string, testSuite []string) error {
 		}
 		fmt.Printf("\n========= [UpdateSet #%d] =========\n", updateSet.ID)
 
+		if empty := filterUpdateSet(updateSet, scopeConfig); empty {
+			resultSet := &UpdateSetResult{UpdateSetID: updateSet.ID, ProjectSlug: projectSlug, State: UPDATE_SET_SKIPPED}
+			fmt.Println("Update set filtered out entirely by .gemnasium/config.yml, skipping.")
+			if err := pushUpdateSetResult(resultSet, baseBranch); err != nil {
+				return err
+			}
+			continue
+		}
+
+		branch := vcs.BranchName(updateSet.ID)
+		if err := localRepo.CheckoutNewBranch(branch); err != nil {
+			return err
+		}
+
 		// We have an updateSet, let's patch files and run tests
-		// We need to keep a list of updated files to restore them after this run
-		orgDepFiles, uptDepFiles, err := applyUpdateSet(updateSet)
+		_, uptDepFiles, err := applyUpdateSet(updateSet)
 		resultSet := &UpdateSetResult{UpdateSetID: updateSet.ID, ProjectSlug: projectSlug, DependencyFiles: uptDepFiles}
 		if err == cantInstallRequirements || err == cantUpdateVersions {
 			resultSet.State = UPDATE_SET_INVALID
-			err := pushUpdateSetResult(resultSet)
-			if err != nil {
+			if err := pushUpdateSetResult(resultSet, baseBranch); err != nil {
 				return err
 			}
-
-			err = restoreDepFiles(orgDepFiles)
-			if err != nil {
-				fmt.Printf("Error while restoring files: %s\n", err)
+			if err := syncPullRequest(localRepo, updateSet, uptDepFiles, branch, baseBranch, false, scopeConfig); err != nil {
+				fmt.Printf("Error while closing a stale pull/merge request: %s\n", err)
+			}
+			if err := restoreBaseBranch(localRepo, baseBranch, branch); err != nil {
+				return err
 			}
 			// No need to try the update, it will fail
 			continue
@@ -116,43 +176,57 @@ func Run(projectSlug string, testSuite []string) error {
 		if err == nil {
 			// we found a valid candidate
 			resultSet.State = UPDATE_SET_SUCCESS
-			err := pushUpdateSetResult(resultSet)
-			if err != nil {
+			if err := pushUpdateSetResult(resultSet, baseBranch); err != nil {
 				return err
 			}
 
-			err = restoreDepFiles(orgDepFiles)
-			if err != nil {
-				return err
+			if err := syncPullRequest(localRepo, updateSet, uptDepFiles, branch, baseBranch, true, scopeConfig); err != nil {
+				fmt.Printf("Error while opening pull/merge request: %s\n", err)
 			}
 
+			if err := restoreBaseBranch(localRepo, baseBranch, branch); err != nil {
+				return err
+			}
 			continue
 		}
 		// display cmd output
 		fmt.Printf("%s\n", out)
 		resultSet.State = UPDATE_SET_FAIL
-		err = pushUpdateSetResult(resultSet)
-		if err != nil {
+		if err := pushUpdateSetResult(resultSet, baseBranch); err != nil {
 			return err
 		}
-		err = restoreDepFiles(orgDepFiles)
-		if err != nil {
-			fmt.Printf("Error while restoring files: %s\n", err)
+		if err := syncPullRequest(localRepo, updateSet, uptDepFiles, branch, baseBranch, false, scopeConfig); err != nil {
+			fmt.Printf("Error while closing a stale pull/merge request: %s\n", err)
+		}
+		if err := restoreBaseBranch(localRepo, baseBranch, branch); err != nil {
+			return err
 		}
 		// Let's continue with another set
 	}
 	return nil
 }
 
-func fetchUpdateSet(projectSlug string) (*UpdateSet, error) {
-	revision := utils.GetCurrentRevision()
+// restoreBaseBranch switches the worktree back to baseBranch and deletes the
+// ephemeral per-UpdateSet branch. ResetHard only moves the tip of whichever
+// branch is currently checked out, so without this the working tree would
+// stay on the throwaway branch after Run returns, and a later Run against
+// the same (e.g. cached CI) workspace would fail to recreate it for the
+// same UpdateSet ID.
+func restoreBaseBranch(localRepo *repo.Repo, baseBranch, ephemeralBranch string) error {
+	if err := localRepo.CheckoutBranch(baseBranch); err != nil {
+		return err
+	}
+	return localRepo.DeleteBranch(ephemeralBranch)
+}
+
+func fetchUpdateSet(projectSlug, revision, branch string) (*UpdateSet, error) {
 	if revision == "" {
 		return nil, errors.New("Can't determine current revision, please use REVISION env var to specify it")
 	}
 	var updateSet *UpdateSet
 	opts := &gemnasium.APIRequestOptions{
 		Method: "POST",
-		URI:    fmt.Sprintf("/projects/%s/branches/%s/update_sets/next", projectSlug, utils.GetCurrentBranch()),
+		URI:    fmt.Sprintf("/projects/%s/branches/%s/update_sets/next", projectSlug, branch),
 		Body:   &map[string]string{"revision": revision},
 		Result: &updateSet,
 	}
@@ -164,6 +238,63 @@ func fetchUpdateSet(projectSlug string) (*UpdateSet, error) {
 	return updateSet, nil
 }
 
+// filterUpdateSet drops, in place, any VersionUpdate disallowed by the
+// user's .gemnasium/config.yml (ignored package, or bump class above what
+// update_types allows). It reports whether the update set is empty
+// afterwards, meaning it should be reported as UPDATE_SET_SKIPPED instead of
+// being applied.
+func filterUpdateSet(updateSet *UpdateSet, cfg *cfgautoupdate.Config) (empty bool) {
+	for packageType, versionUpdates := range updateSet.VersionUpdates {
+		rule := cfg.RuleFor(packageType)
+		if rule == nil {
+			continue
+		}
+
+		kept := versionUpdates[:0]
+		for _, vu := range versionUpdates {
+			if rule.Allows(vu.Package.Name, bumpClass(vu.OldVersion, vu.TargetVersion)) {
+				kept = append(kept, vu)
+			}
+		}
+		if len(kept) == 0 {
+			delete(updateSet.VersionUpdates, packageType)
+		} else {
+			updateSet.VersionUpdates[packageType] = kept
+		}
+	}
+
+	return len(updateSet.RequirementUpdates) == 0 && len(updateSet.VersionUpdates) == 0
+}
+
+// bumpClass classifies a version bump as "major", "minor" or "patch",
+// matching the `update_types: ["semver:patch", ...]` keys used in
+// .gemnasium/config.yml. It returns "" when either version isn't valid
+// semver (common outside Go modules, e.g. PEP 440) rather than guessing,
+// since EcosystemRule.Allows treats an unrecognized bump class as
+// unmatched, not a free pass.
+func bumpClass(oldVersion, targetVersion string) string {
+	old, target := normalizeSemver(oldVersion), normalizeSemver(targetVersion)
+	if !semver.IsValid(old) || !semver.IsValid(target) {
+		return ""
+	}
+	if semver.Major(old) != semver.Major(target) {
+		return "major"
+	}
+	if semver.MajorMinor(old) != semver.MajorMinor(target) {
+		return "minor"
+	}
+	return "patch"
+}
+
+// normalizeSemver ensures a version string has the leading "v" that
+// golang.org/x/mod/semver requires, since package ecosystems rarely do.
+func normalizeSemver(v string) string {
+	if strings.HasPrefix(v, "v") {
+		return v
+	}
+	return "v" + v
+}
+
 // Patch files if needed, and update packages
 // Will return a slice of original files and a slice of the updated files, with
 // their content
@@ -197,7 +328,7 @@ func applyUpdateSet(updateSet *UpdateSet) (orgDepFiles, uptDepFiles []models.Dep
 
 // Once update set has been tested, we must send the result to Gemnasium,
 // in order to update statitics.
-func pushUpdateSetResult(rs *UpdateSetResult) error {
+func pushUpdateSetResult(rs *UpdateSetResult, branch string) error {
 	fmt.Printf("Pushing result (status='%s'): ", rs.State)
 
 	if rs.UpdateSetID == 0 || rs.State == "" {
@@ -206,7 +337,7 @@ func pushUpdateSetResult(rs *UpdateSetResult) error {
 
 	opts := &gemnasium.APIRequestOptions{
 		Method: "PATCH",
-		URI:    fmt.Sprintf("/projects/%s/branches/%s/update_sets/%d", rs.ProjectSlug, utils.GetCurrentBranch(), rs.UpdateSetID),
+		URI:    fmt.Sprintf("/projects/%s/branches/%s/update_sets/%d", rs.ProjectSlug, branch, rs.UpdateSetID),
 		Body:   rs,
 	}
 	err := gemnasium.APIRequest(opts)
@@ -218,21 +349,6 @@ func pushUpdateSetResult(rs *UpdateSetResult) error {
 	return nil
 }
 
-// Restore original files.
-// Needed after each run
-func restoreDepFiles(dfiles []models.DependencyFile) error {
-	fmt.Printf("%d file(s) to be restored.\n", len(dfiles))
-	for _, df := range dfiles {
-		fmt.Printf("Restoring file %s: ", df.Path)
-		err := ioutil.WriteFile(df.Path, df.Content, 0644)
-		if err != nil {
-			return err
-		}
-		fmt.Printf("done\n")
-	}
-	return nil
-}
-
 func executeTestSuite(ts []string) ([]byte, error) {
 	type Result struct {
 		Output []byte
@@ -266,3 +382,132 @@ func executeTestSuite(ts []string) ([]byte, error) {
 	fmt.Printf("done (%fs)\n", time.Since(start).Seconds())
 	return out, err
 }
+
+// syncPullRequest reconciles the forge-side pull/merge request for an
+// UpdateSet with its latest test outcome. When passing, it commits the
+// patched dependency files on branch (already checked out by the caller),
+// pushes it, and opens a PR against baseBranch (or the ecosystem's
+// target_branch override, if .gemnasium/config.yml sets one) -- unless one
+// is already open from this branch, in which case nothing is committed or
+// pushed and the open PR is left as it is.
+// When not passing, any PR a previous run left open for this UpdateSet is
+// stale (the update no longer works) and gets closed instead.
+func syncPullRequest(localRepo *repo.Repo, updateSet *UpdateSet, depFiles []models.DependencyFile, branch, baseBranch string, passing bool, scopeConfig *cfgautoupdate.Config) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	rule := ruleForUpdateSet(scopeConfig, updateSet)
+
+	targetBranch := baseBranch
+	if rule != nil && rule.TargetBranch != "" {
+		targetBranch = rule.TargetBranch
+	}
+
+	remoteURL, err := localRepo.RemoteURL("origin")
+	if err != nil {
+		return err
+	}
+	source, err := vcs.DetectSource(remoteURL, cfg)
+	if err != nil {
+		return err
+	}
+
+	openPRs, err := source.ListOpenPullRequests(targetBranch)
+	if err != nil {
+		return err
+	}
+	var existing *vcs.PullRequest
+	for i := range openPRs {
+		if openPRs[i].Branch == branch {
+			existing = &openPRs[i]
+			break
+		}
+	}
+
+	if !passing {
+		if existing == nil {
+			return nil
+		}
+		fmt.Printf("Closing stale pull/merge request #%d for update set #%d\n", existing.Number, updateSet.ID)
+		return source.ClosePullRequest(existing.Number)
+	}
+
+	if existing != nil {
+		fmt.Printf("Pull/merge request #%d already open for update set #%d, nothing to do\n", existing.Number, updateSet.ID)
+		return nil
+	}
+
+	paths := make([]string, len(depFiles))
+	for i, df := range depFiles {
+		paths[i] = df.Path
+	}
+	message := fmt.Sprintf("Update dependencies (update set #%d)", updateSet.ID)
+	if _, err := localRepo.CommitPaths(paths, message, localRepo.Signature()); err != nil {
+		return err
+	}
+	username, password := source.GitAuth()
+	if err := localRepo.Push("origin", branch, username, password); err != nil {
+		return err
+	}
+
+	titleTemplate, bodyTemplate := cfg.PRTitleTemplate, cfg.PRBodyTemplate
+	if rule != nil {
+		if rule.PRTitleTemplate != "" {
+			titleTemplate = rule.PRTitleTemplate
+		}
+		if rule.PRBodyTemplate != "" {
+			bodyTemplate = rule.PRBodyTemplate
+		}
+	}
+	templates, err := vcs.NewTemplates(titleTemplate, bodyTemplate)
+	if err != nil {
+		return err
+	}
+	title, body, err := templates.Render(firstVersionUpdate(updateSet))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Opening pull/merge request for update set #%d: ", updateSet.ID)
+	number, err := source.OpenPullRequest(branch, targetBranch, title, body)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("done (#%d)\n", number)
+	return nil
+}
+
+// ruleForUpdateSet returns the EcosystemRule scoping updateSet's ecosystem,
+// picking the first one declared in .gemnasium/config.yml among the
+// update set's ecosystems (same "pick the first" convention as
+// firstVersionUpdate), or nil if none is declared.
+func ruleForUpdateSet(scopeConfig *cfgautoupdate.Config, updateSet *UpdateSet) *cfgautoupdate.EcosystemRule {
+	for packageType := range updateSet.VersionUpdates {
+		if rule := scopeConfig.RuleFor(packageType); rule != nil {
+			return rule
+		}
+	}
+	for packageType := range updateSet.RequirementUpdates {
+		if rule := scopeConfig.RuleFor(packageType); rule != nil {
+			return rule
+		}
+	}
+	return nil
+}
+
+// firstVersionUpdate picks the VersionUpdate used to render the PR
+// title/body templates. Update sets bump one package at a time, so the
+// first (and usually only) entry is representative.
+func firstVersionUpdate(updateSet *UpdateSet) vcs.TemplateData {
+	for _, versionUpdates := range updateSet.VersionUpdates {
+		for _, vu := range versionUpdates {
+			return vcs.TemplateData{
+				Package:       vu.Package.Name,
+				OldVersion:    vu.OldVersion,
+				TargetVersion: vu.TargetVersion,
+			}
+		}
+	}
+	return vcs.TemplateData{}
+}
@@ -0,0 +1,34 @@
+package autoupdate
+
+import "testing"
+
+func TestBumpClass(t *testing.T) {
+	cases := []struct {
+		old, target, want string
+	}{
+		{"1.2.3", "2.0.0", "major"},
+		{"1.2.3", "1.3.0", "minor"},
+		{"1.2.3", "1.2.4", "patch"},
+		{"v1.2.3", "v1.2.4", "patch"},
+		{"1.2.3", "1.2.3", "patch"},
+		{"1.2.3", "not-a-version", ""},
+		{"1.2.3.post1", "1.2.4", ""},
+	}
+	for _, c := range cases {
+		if got := bumpClass(c.old, c.target); got != c.want {
+			t.Errorf("bumpClass(%q, %q) = %q, want %q", c.old, c.target, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeSemver(t *testing.T) {
+	cases := map[string]string{
+		"1.2.3":  "v1.2.3",
+		"v1.2.3": "v1.2.3",
+	}
+	for in, want := range cases {
+		if got := normalizeSemver(in); got != want {
+			t.Errorf("normalizeSemver(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
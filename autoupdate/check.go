@@ -0,0 +1,74 @@
+package autoupdate
+
+import "github.com/gemnasium/toolbelt/vcs/repo"
+
+const UPDATE_SET_DEFERRED = "deferred"
+
+// PackageSummary describes a single pending version bump, as reported by
+// `gemnasium autoupdate check`.
+type PackageSummary struct {
+	Ecosystem      string `json:"ecosystem"`
+	Package        string `json:"package"`
+	CurrentVersion string `json:"current_version"`
+	TargetVersion  string `json:"target_version"`
+	Bump           string `json:"bump"`
+}
+
+// UpdateSetSummary is the dry-run view of an UpdateSet: what it would do,
+// without applying it.
+type UpdateSetSummary struct {
+	ID       int              `json:"id"`
+	Packages []PackageSummary `json:"packages"`
+}
+
+// CheckUpdate enumerates every pending UpdateSet for projectSlug without
+// mutating the workspace: each fetched set is immediately reported back to
+// Gemnasium with a `deferred` state, so the server re-serves it on the next
+// real `autoupdate.Run`.
+func CheckUpdate(projectSlug string) ([]UpdateSetSummary, error) {
+	var summaries []UpdateSetSummary
+
+	localRepo, err := repo.Open(".")
+	if err != nil {
+		return nil, err
+	}
+	revision, err := localRepo.HeadRevision()
+	if err != nil {
+		return nil, err
+	}
+	branch, err := localRepo.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		updateSet, err := fetchUpdateSet(projectSlug, revision, branch)
+		if err != nil {
+			return summaries, err
+		}
+		if updateSet.ID == 0 {
+			break
+		}
+
+		summary := UpdateSetSummary{ID: updateSet.ID}
+		for packageType, versionUpdates := range updateSet.VersionUpdates {
+			for _, vu := range versionUpdates {
+				summary.Packages = append(summary.Packages, PackageSummary{
+					Ecosystem:      packageType,
+					Package:        vu.Package.Name,
+					CurrentVersion: vu.OldVersion,
+					TargetVersion:  vu.TargetVersion,
+					Bump:           bumpClass(vu.OldVersion, vu.TargetVersion),
+				})
+			}
+		}
+		summaries = append(summaries, summary)
+
+		resultSet := &UpdateSetResult{UpdateSetID: updateSet.ID, ProjectSlug: projectSlug, State: UPDATE_SET_DEFERRED}
+		if err := pushUpdateSetResult(resultSet, branch); err != nil {
+			return summaries, err
+		}
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,200 @@
+package autoupdate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+
+	"github.com/urfave/cli"
+
+	"github.com/gemnasium/toolbelt/autoupdate/vcs"
+	cfgautoupdate "github.com/gemnasium/toolbelt/config/autoupdate"
+	"github.com/gemnasium/toolbelt/models"
+	"github.com/gemnasium/toolbelt/vcs/repo"
+)
+
+// applyMu serializes the (comparatively fast) file-patching step across
+// workers, since NewRequirementsInstaller/NewUpdater operate on the process's
+// current working directory rather than taking one as an argument. The slow
+// part, executeTestSuiteContext, runs with no lock held so worker test runs
+// genuinely overlap.
+var applyMu sync.Mutex
+
+// workerResult is what a worker reports back for a single UpdateSet, to be
+// pushed to Gemnasium once every worker's results are collected and sorted.
+type workerResult struct {
+	updateSetID int
+	resultSet   *UpdateSetResult
+	prErr       error
+}
+
+// runConcurrent runs up to `jobs` UpdateSets in parallel, each in its own
+// git worktree, until ctx's deadline (AUTOUPDATE_MAX_DURATION) or the server
+// reports no more work.
+func runConcurrent(ctx context.Context, projectSlug string, testSuite []string, jobs int, localRepo *repo.Repo, checkpoint, baseBranch string, scopeConfig *cfgautoupdate.Config) error {
+	resultsCh := make(chan workerResult)
+	var errsMu sync.Mutex
+	var workerErrs []error
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			if err := runWorker(ctx, workerID, projectSlug, testSuite, localRepo, checkpoint, baseBranch, scopeConfig, resultsCh); err != nil {
+				errsMu.Lock()
+				workerErrs = append(workerErrs, err)
+				errsMu.Unlock()
+			}
+		}(i)
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultsCh)
+	}()
+
+	var results []workerResult
+	for r := range resultsCh {
+		results = append(results, r)
+	}
+
+	// Push results in deterministic order, regardless of which worker
+	// finished first.
+	sort.Slice(results, func(i, j int) bool { return results[i].updateSetID < results[j].updateSetID })
+
+	for _, r := range results {
+		if err := pushUpdateSetResult(r.resultSet, baseBranch); err != nil {
+			errsMu.Lock()
+			workerErrs = append(workerErrs, err)
+			errsMu.Unlock()
+		}
+		if r.prErr != nil {
+			fmt.Printf("Error while opening pull/merge request for update set #%d: %s\n", r.updateSetID, r.prErr)
+		}
+	}
+
+	if len(workerErrs) > 0 {
+		return cli.NewMultiError(workerErrs...)
+	}
+	return nil
+}
+
+// runWorker repeatedly fetches, patches, and tests UpdateSets in its own
+// worktree until there's no more work, ctx is done, or a non-recoverable
+// error occurs.
+func runWorker(ctx context.Context, workerID int, projectSlug string, testSuite []string, localRepo *repo.Repo, checkpoint, baseBranch string, scopeConfig *cfgautoupdate.Config, resultsCh chan<- workerResult) error {
+	dir, err := ioutil.TempDir("", fmt.Sprintf("gemnasium-autoupdate-worker-%d-", workerID))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	workerRepo, err := localRepo.Worktree(dir)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Always start the iteration from the checkpoint, exactly like the
+		// sequential loop does: restoreBaseBranch only switches branches and
+		// deletes the ephemeral one, it doesn't discard the uncommitted
+		// patches a failed/invalid iteration left lying around (checking out
+		// baseBranch is a worktree no-op when it and the ephemeral branch
+		// still point at the same commit).
+		if err := workerRepo.ResetHard(checkpoint); err != nil {
+			return err
+		}
+
+		updateSet, err := fetchUpdateSet(projectSlug, checkpoint, baseBranch)
+		if err != nil {
+			return err
+		}
+		if updateSet.ID == 0 {
+			return nil
+		}
+		fmt.Printf("\n========= [UpdateSet #%d] (worker %d) =========\n", updateSet.ID, workerID)
+
+		if empty := filterUpdateSet(updateSet, scopeConfig); empty {
+			resultsCh <- workerResult{updateSetID: updateSet.ID, resultSet: &UpdateSetResult{UpdateSetID: updateSet.ID, ProjectSlug: projectSlug, State: UPDATE_SET_SKIPPED}}
+			continue
+		}
+
+		branch := vcs.BranchName(updateSet.ID)
+		if err := workerRepo.CheckoutNewBranch(branch); err != nil {
+			return err
+		}
+
+		_, uptDepFiles, err := workerApplyUpdateSet(dir, updateSet)
+		resultSet := &UpdateSetResult{UpdateSetID: updateSet.ID, ProjectSlug: projectSlug, DependencyFiles: uptDepFiles}
+		if err == cantInstallRequirements || err == cantUpdateVersions {
+			resultSet.State = UPDATE_SET_INVALID
+			resultsCh <- workerResult{updateSetID: updateSet.ID, resultSet: resultSet}
+			if err := syncPullRequest(workerRepo, updateSet, uptDepFiles, branch, baseBranch, false, scopeConfig); err != nil {
+				fmt.Printf("Error while closing a stale pull/merge request for update set #%d: %s\n", updateSet.ID, err)
+			}
+			if err := restoreBaseBranch(workerRepo, baseBranch, branch); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		out, err := executeTestSuiteContext(ctx, testSuite, dir)
+		if err == nil {
+			resultSet.State = UPDATE_SET_SUCCESS
+			var prErr error
+			if prErr = syncPullRequest(workerRepo, updateSet, uptDepFiles, branch, baseBranch, true, scopeConfig); prErr != nil {
+				prErr = fmt.Errorf("update set #%d: %w", updateSet.ID, prErr)
+			}
+			resultsCh <- workerResult{updateSetID: updateSet.ID, resultSet: resultSet, prErr: prErr}
+		} else {
+			fmt.Printf("%s\n", out)
+			resultSet.State = UPDATE_SET_FAIL
+			resultsCh <- workerResult{updateSetID: updateSet.ID, resultSet: resultSet}
+			if err := syncPullRequest(workerRepo, updateSet, uptDepFiles, branch, baseBranch, false, scopeConfig); err != nil {
+				fmt.Printf("Error while closing a stale pull/merge request for update set #%d: %s\n", updateSet.ID, err)
+			}
+		}
+
+		if err := restoreBaseBranch(workerRepo, baseBranch, branch); err != nil {
+			return err
+		}
+	}
+}
+
+// workerApplyUpdateSet runs applyUpdateSet against dir instead of the
+// process's current working directory.
+func workerApplyUpdateSet(dir string, updateSet *UpdateSet) (orgDepFiles, uptDepFiles []models.DependencyFile, err error) {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return nil, nil, err
+	}
+	defer os.Chdir(cwd)
+
+	return applyUpdateSet(updateSet)
+}
+
+// executeTestSuiteContext runs the test suite in dir, killing it if ctx is
+// canceled or its deadline passes.
+func executeTestSuiteContext(ctx context.Context, ts []string, dir string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, ts[0], ts[1:]...)
+	cmd.Dir = dir
+	return cmd.Output()
+}
@@ -0,0 +1,149 @@
+package vcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// GiteaSource talks to a (possibly self-hosted) Gitea instance's REST API on
+// behalf of a single `owner/repo`.
+type GiteaSource struct {
+	token    string
+	endpoint string // e.g. https://gitea.example.com/api/v1
+	owner    string
+	repo     string
+}
+
+func NewGiteaSource(cfg *config.Config, remoteURL, owner, repo string) *GiteaSource {
+	return &GiteaSource{
+		token:    tokenFor(cfg.GiteaToken, host(remoteURL)),
+		endpoint: "https://" + host(remoteURL) + "/api/v1",
+		owner:    owner,
+		repo:     repo,
+	}
+}
+
+// host extracts the hostname from a scp-like or https git remote URL.
+func host(remoteURL string) string {
+	remoteURL = strings.TrimPrefix(remoteURL, "https://")
+	remoteURL = strings.TrimPrefix(remoteURL, "http://")
+	remoteURL = strings.TrimPrefix(remoteURL, "git@")
+	if i := strings.IndexAny(remoteURL, ":/"); i != -1 {
+		return remoteURL[:i]
+	}
+	return remoteURL
+}
+
+func (s *GiteaSource) OpenPullRequest(branch, baseBranch, title, body string) (int, error) {
+	resp, err := s.post(fmt.Sprintf("/repos/%s/%s/pulls", s.owner, s.repo), map[string]string{
+		"head":  branch,
+		"base":  baseBranch,
+		"title": title,
+		"body":  body,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var pr struct {
+		Number int `json:"number"`
+	}
+	if err := json.Unmarshal(resp, &pr); err != nil {
+		return 0, err
+	}
+	return pr.Number, nil
+}
+
+func (s *GiteaSource) ClosePullRequest(number int) error {
+	req, err := s.newRequest("PATCH", fmt.Sprintf("/repos/%s/%s/pulls/%d", s.owner, s.repo, number), map[string]string{"state": "closed"})
+	if err != nil {
+		return err
+	}
+	_, err = s.do(req)
+	return err
+}
+
+func (s *GiteaSource) ListOpenPullRequests(baseBranch string) ([]PullRequest, error) {
+	body, err := s.get(fmt.Sprintf("/repos/%s/%s/pulls?state=open&base=%s", s.owner, s.repo, baseBranch))
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		URL    string `json:"html_url"`
+		Head   struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	prs := make([]PullRequest, 0, len(raw))
+	for _, r := range raw {
+		prs = append(prs, PullRequest{Number: r.Number, Title: r.Title, Branch: r.Head.Ref, URL: r.URL})
+	}
+	return prs, nil
+}
+
+// GitAuth returns credentials for pushing over HTTPS: Gitea accepts any
+// non-empty username alongside the token as password.
+func (s *GiteaSource) GitAuth() (username, password string) {
+	return "gemnasium-autoupdate", s.token
+}
+
+func (s *GiteaSource) get(path string) ([]byte, error) {
+	req, err := s.newRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *GiteaSource) post(path string, payload interface{}) ([]byte, error) {
+	req, err := s.newRequest("POST", path, payload)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *GiteaSource) newRequest(method, path string, payload interface{}) (*http.Request, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (s *GiteaSource) do(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("gitea: server returned non-2xx status: %s\n%s", resp.Status, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,138 @@
+package vcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+const githubAPIEndpoint = "https://api.github.com"
+
+// GithubSource talks to the GitHub REST API on behalf of a single
+// `owner/repo`.
+type GithubSource struct {
+	token string
+	owner string
+	repo  string
+}
+
+func NewGithubSource(cfg *config.Config, owner, repo string) *GithubSource {
+	return &GithubSource{
+		token: tokenFor(cfg.GithubToken, "api.github.com"),
+		owner: owner,
+		repo:  repo,
+	}
+}
+
+func (s *GithubSource) OpenPullRequest(branch, baseBranch, title, body string) (int, error) {
+	resp, err := s.post(fmt.Sprintf("/repos/%s/%s/pulls", s.owner, s.repo), map[string]string{
+		"title": title,
+		"body":  body,
+		"head":  branch,
+		"base":  baseBranch,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var pr struct {
+		Number int `json:"number"`
+	}
+	if err := json.Unmarshal(resp, &pr); err != nil {
+		return 0, err
+	}
+	return pr.Number, nil
+}
+
+func (s *GithubSource) ClosePullRequest(number int) error {
+	req, err := s.newRequest("PATCH", fmt.Sprintf("/repos/%s/%s/pulls/%d", s.owner, s.repo, number), map[string]string{"state": "closed"})
+	if err != nil {
+		return err
+	}
+	_, err = s.do(req)
+	return err
+}
+
+func (s *GithubSource) ListOpenPullRequests(baseBranch string) ([]PullRequest, error) {
+	body, err := s.get(fmt.Sprintf("/repos/%s/%s/pulls?state=open&base=%s", s.owner, s.repo, baseBranch))
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Head    struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	prs := make([]PullRequest, 0, len(raw))
+	for _, r := range raw {
+		prs = append(prs, PullRequest{Number: r.Number, Title: r.Title, Branch: r.Head.Ref, URL: r.HTMLURL})
+	}
+	return prs, nil
+}
+
+// GitAuth returns credentials for pushing over HTTPS: GitHub accepts any
+// non-empty username alongside the token as password.
+func (s *GithubSource) GitAuth() (username, password string) {
+	return "x-access-token", s.token
+}
+
+func (s *GithubSource) get(path string) ([]byte, error) {
+	req, err := s.newRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *GithubSource) post(path string, payload interface{}) ([]byte, error) {
+	req, err := s.newRequest("POST", path, payload)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *GithubSource) newRequest(method, path string, payload interface{}) (*http.Request, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, githubAPIEndpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+s.token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (s *GithubSource) do(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("github: server returned non-2xx status: %s\n%s", resp.Status, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,139 @@
+package vcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// GitlabSource talks to a (possibly self-hosted) GitLab instance's REST API
+// on behalf of a single project.
+type GitlabSource struct {
+	token    string
+	endpoint string // e.g. https://gitlab.example.com/api/v4
+	project  string // owner/repo, URL-encoded on use
+}
+
+func NewGitlabSource(cfg *config.Config, remoteURL, owner, repo string) *GitlabSource {
+	return &GitlabSource{
+		token:    tokenFor(cfg.GitlabToken, host(remoteURL)),
+		endpoint: "https://" + host(remoteURL) + "/api/v4",
+		project:  owner + "/" + repo,
+	}
+}
+
+func (s *GitlabSource) OpenPullRequest(branch, baseBranch, title, body string) (int, error) {
+	resp, err := s.post(fmt.Sprintf("/projects/%s/merge_requests", s.encodedProject()), map[string]string{
+		"source_branch": branch,
+		"target_branch": baseBranch,
+		"title":         title,
+		"description":   body,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var mr struct {
+		IID int `json:"iid"`
+	}
+	if err := json.Unmarshal(resp, &mr); err != nil {
+		return 0, err
+	}
+	return mr.IID, nil
+}
+
+func (s *GitlabSource) ClosePullRequest(number int) error {
+	req, err := s.newRequest("PUT", fmt.Sprintf("/projects/%s/merge_requests/%d", s.encodedProject(), number), map[string]string{"state_event": "close"})
+	if err != nil {
+		return err
+	}
+	_, err = s.do(req)
+	return err
+}
+
+func (s *GitlabSource) ListOpenPullRequests(baseBranch string) ([]PullRequest, error) {
+	body, err := s.get(fmt.Sprintf("/projects/%s/merge_requests?state=opened&target_branch=%s", s.encodedProject(), baseBranch))
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		IID          int    `json:"iid"`
+		Title        string `json:"title"`
+		WebURL       string `json:"web_url"`
+		SourceBranch string `json:"source_branch"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	prs := make([]PullRequest, 0, len(raw))
+	for _, r := range raw {
+		prs = append(prs, PullRequest{Number: r.IID, Title: r.Title, Branch: r.SourceBranch, URL: r.WebURL})
+	}
+	return prs, nil
+}
+
+func (s *GitlabSource) encodedProject() string {
+	return url.PathEscape(s.project)
+}
+
+// GitAuth returns credentials for pushing over HTTPS: GitLab's convention
+// for a personal/project access token is "oauth2" as the username and the
+// token as password.
+func (s *GitlabSource) GitAuth() (username, password string) {
+	return "oauth2", s.token
+}
+
+func (s *GitlabSource) get(path string) ([]byte, error) {
+	req, err := s.newRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *GitlabSource) post(path string, payload interface{}) ([]byte, error) {
+	req, err := s.newRequest("POST", path, payload)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req)
+}
+
+func (s *GitlabSource) newRequest(method, path string, payload interface{}) (*http.Request, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", s.token)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (s *GitlabSource) do(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("gitlab: server returned non-2xx status: %s\n%s", resp.Status, body)
+	}
+	return body, nil
+}
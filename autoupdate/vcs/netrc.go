@@ -0,0 +1,34 @@
+package vcs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/bgentry/go-netrc/netrc"
+)
+
+// tokenFor resolves the API token to use for `host`, preferring an explicit
+// value (usually read from config.Config) and falling back to the user's
+// ~/.netrc, so CI environments that only provision credentials via netrc
+// keep working.
+func tokenFor(explicit, host string) string {
+	if explicit != "" {
+		return explicit
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	n, err := netrc.ParseFile(filepath.Join(home, ".netrc"))
+	if err != nil {
+		return ""
+	}
+
+	machine := n.FindMachine(host)
+	if machine == nil {
+		return ""
+	}
+	return machine.Password
+}
@@ -0,0 +1,62 @@
+package vcs
+
+import (
+	"bytes"
+	"text/template"
+)
+
+const (
+	DefaultTitleTemplate = `Bump {{.Package}} from {{.OldVersion}} to {{.TargetVersion}}`
+	DefaultBodyTemplate  = `Bumps {{.Package}} from {{.OldVersion}} to {{.TargetVersion}}.`
+)
+
+// TemplateData is the context exposed to PR title/body templates, built from
+// a single VersionUpdate. For an update set with no VersionUpdate (only
+// requirement updates), every field is empty.
+type TemplateData struct {
+	Package       string
+	OldVersion    string
+	TargetVersion string
+}
+
+// Templates holds the parsed text/template pair used to render a pull/merge
+// request's title and body.
+type Templates struct {
+	Title *template.Template
+	Body  *template.Template
+}
+
+// NewTemplates parses the given title/body template strings, falling back to
+// DefaultTitleTemplate/DefaultBodyTemplate when empty (e.g. not set in
+// .gemnasium/config.yml).
+func NewTemplates(titleTpl, bodyTpl string) (*Templates, error) {
+	if titleTpl == "" {
+		titleTpl = DefaultTitleTemplate
+	}
+	if bodyTpl == "" {
+		bodyTpl = DefaultBodyTemplate
+	}
+
+	title, err := template.New("pr_title").Parse(titleTpl)
+	if err != nil {
+		return nil, err
+	}
+	body, err := template.New("pr_body").Parse(bodyTpl)
+	if err != nil {
+		return nil, err
+	}
+	return &Templates{Title: title, Body: body}, nil
+}
+
+// Render fills the title/body templates with data and returns the rendered
+// strings.
+func (t *Templates) Render(data TemplateData) (title, body string, err error) {
+	var titleBuf, bodyBuf bytes.Buffer
+	if err := t.Title.Execute(&titleBuf, data); err != nil {
+		return "", "", err
+	}
+	if err := t.Body.Execute(&bodyBuf, data); err != nil {
+		return "", "", err
+	}
+	return titleBuf.String(), bodyBuf.String(), nil
+}
@@ -0,0 +1,70 @@
+/*
+Package vcs opens pull/merge requests on the forge hosting a project's git
+remote, once an UpdateSet has passed its test suite.
+
+A Source is implemented once per forge (GitHub, GitLab, Gitea). DetectSource
+inspects the `origin` remote URL and returns the matching backend. Branching
+and committing are handled locally by vcs/repo (built on go-git); Source only
+covers what a forge's REST API is actually needed for: opening, closing and
+listing pull/merge requests.
+*/
+package vcs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+// Source is a forge capable of hosting pull/merge requests.
+type Source interface {
+	// OpenPullRequest opens a pull/merge request from `branch` onto `baseBranch`
+	// and returns its forge-assigned number.
+	OpenPullRequest(branch, baseBranch, title, body string) (int, error)
+	// ClosePullRequest closes the pull/merge request without merging it.
+	ClosePullRequest(number int) error
+	// ListOpenPullRequests lists pull/merge requests currently open against baseBranch.
+	ListOpenPullRequests(baseBranch string) ([]PullRequest, error)
+	// GitAuth returns the HTTP basic-auth credentials the ephemeral branch
+	// should be pushed with before a pull/merge request is opened for it.
+	GitAuth() (username, password string)
+}
+
+// PullRequest is the subset of forge data the autoupdate loop cares about.
+type PullRequest struct {
+	Number int
+	Title  string
+	Branch string
+	URL    string
+}
+
+var (
+	githubRemoteRE = regexp.MustCompile(`github\.com[:/]([^/]+)/([^/.]+?)(\.git)?$`)
+	gitlabRemoteRE = regexp.MustCompile(`gitlab\.[^:/]+[:/]([^/]+)/([^/.]+?)(\.git)?$`)
+	giteaRemoteRE  = regexp.MustCompile(`gitea\.[^:/]+[:/]([^/]+)/([^/.]+?)(\.git)?$`)
+)
+
+// DetectSource looks at a git remote URL (typically `origin`) and returns the
+// Source backend able to manage pull/merge requests for it.
+func DetectSource(remoteURL string, cfg *config.Config) (Source, error) {
+	remoteURL = strings.TrimSpace(remoteURL)
+
+	if m := githubRemoteRE.FindStringSubmatch(remoteURL); m != nil {
+		return NewGithubSource(cfg, m[1], m[2]), nil
+	}
+	if m := gitlabRemoteRE.FindStringSubmatch(remoteURL); m != nil {
+		return NewGitlabSource(cfg, remoteURL, m[1], m[2]), nil
+	}
+	if m := giteaRemoteRE.FindStringSubmatch(remoteURL); m != nil {
+		return NewGiteaSource(cfg, remoteURL, m[1], m[2]), nil
+	}
+
+	return nil, fmt.Errorf("vcs: can't detect forge from remote URL %q", remoteURL)
+}
+
+// BranchName builds the ephemeral branch name an UpdateSet is shipped on.
+func BranchName(updateSetID int) string {
+	return fmt.Sprintf("gemnasium/update-set-%d", updateSetID)
+}
@@ -0,0 +1,63 @@
+package vcs
+
+import (
+	"testing"
+
+	"github.com/gemnasium/toolbelt/config"
+)
+
+func TestDetectSource(t *testing.T) {
+	cfg := &config.Config{}
+	cases := []struct {
+		remoteURL string
+		wantType  interface{}
+	}{
+		{"git@github.com:gemnasium/toolbelt.git", &GithubSource{}},
+		{"https://github.com/gemnasium/toolbelt.git", &GithubSource{}},
+		{"git@gitlab.com:gemnasium/toolbelt.git", &GitlabSource{}},
+		{"https://gitlab.com/gemnasium/toolbelt", &GitlabSource{}},
+		{"git@gitlab.example.com:gemnasium/toolbelt.git", &GitlabSource{}},
+		{"git@gitea.example.com:gemnasium/toolbelt.git", &GiteaSource{}},
+	}
+	for _, c := range cases {
+		source, err := DetectSource(c.remoteURL, cfg)
+		if err != nil {
+			t.Errorf("DetectSource(%q) returned error: %s", c.remoteURL, err)
+			continue
+		}
+		switch c.wantType.(type) {
+		case *GithubSource:
+			if _, ok := source.(*GithubSource); !ok {
+				t.Errorf("DetectSource(%q) = %T, want *GithubSource", c.remoteURL, source)
+			}
+		case *GitlabSource:
+			if _, ok := source.(*GitlabSource); !ok {
+				t.Errorf("DetectSource(%q) = %T, want *GitlabSource", c.remoteURL, source)
+			}
+		case *GiteaSource:
+			if _, ok := source.(*GiteaSource); !ok {
+				t.Errorf("DetectSource(%q) = %T, want *GiteaSource", c.remoteURL, source)
+			}
+		}
+	}
+}
+
+func TestDetectSourceUnknownRemote(t *testing.T) {
+	if _, err := DetectSource("git@bitbucket.org:gemnasium/toolbelt.git", &config.Config{}); err == nil {
+		t.Error("DetectSource with an unrecognized forge should return an error")
+	}
+}
+
+func TestDetectSourceSelfHostedGitlabEndpoint(t *testing.T) {
+	source, err := DetectSource("git@gitlab.example.com:gemnasium/toolbelt.git", &config.Config{})
+	if err != nil {
+		t.Fatalf("DetectSource returned error: %s", err)
+	}
+	gitlabSource, ok := source.(*GitlabSource)
+	if !ok {
+		t.Fatalf("DetectSource = %T, want *GitlabSource", source)
+	}
+	if want := "https://gitlab.example.com/api/v4"; gitlabSource.endpoint != want {
+		t.Errorf("endpoint = %q, want %q", gitlabSource.endpoint, want)
+	}
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gemnasium/toolbelt/auth"
+	"github.com/gemnasium/toolbelt/autoupdate"
+	"github.com/urfave/cli"
+)
+
+// AutoUpdateCheck implements `gemnasium autoupdate check`: it previews the
+// update sets autoupdate.Run would attempt, without mutating the workspace
+// or running the test suite.
+func AutoUpdateCheck(ctx *cli.Context) error {
+	auth.AttemptLogin(ctx)
+
+	projectSlug := ctx.String("project-slug")
+	summaries, err := autoupdate.CheckUpdate(projectSlug)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if ctx.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summaries)
+	}
+
+	printUpdateSetSummaries(summaries)
+	return nil
+}
+
+func printUpdateSetSummaries(summaries []autoupdate.UpdateSetSummary) {
+	if len(summaries) == 0 {
+		fmt.Println("No pending update set.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "UPDATE SET\tECOSYSTEM\tPACKAGE\tCURRENT\tTARGET\tBUMP")
+	for _, summary := range summaries {
+		for _, pkg := range summary.Packages {
+			fmt.Fprintf(w, "#%d\t%s\t%s\t%s\t%s\t%s\n", summary.ID, pkg.Ecosystem, pkg.Package, pkg.CurrentVersion, pkg.TargetVersion, pkg.Bump)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/gemnasium/toolbelt/auth"
+	"github.com/gemnasium/toolbelt/autoupdate"
+	"github.com/urfave/cli"
+)
+
+// AutoUpdateRun implements `gemnasium autoupdate run`, testing pending
+// update sets and reporting their status back to Gemnasium.
+func AutoUpdateRun(ctx *cli.Context) error {
+	auth.AttemptLogin(ctx)
+
+	projectSlug := ctx.String("project-slug")
+	testSuite := strings.Fields(ctx.String("test-suite"))
+	err := autoupdate.Run(projectSlug, testSuite, ctx.Int("jobs"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+Package autoupdate loads `.gemnasium/config.yml`, a dependabot-style local
+configuration file that lets users scope what the `autoupdate` package is
+allowed to do: which packages it may touch, how big a version bump it may
+apply, and which branch/PR templates to use.
+*/
+package autoupdate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultPath is where Load looks for the configuration file, relative to
+// the repository root.
+const DefaultPath = ".gemnasium/config.yml"
+
+// Schedule mirrors dependabot.yml's `schedule` block, for config.yml
+// compatibility. The autoupdate loop is triggered externally (CI cron, etc.)
+// and doesn't currently read it.
+type Schedule struct {
+	Interval string `yaml:"interval"`
+}
+
+// EcosystemRule scopes autoupdate behavior for a single package ecosystem
+// (e.g. "bundler", "npm_and_yarn", "go_modules").
+type EcosystemRule struct {
+	PackageEcosystem string   `yaml:"package-ecosystem"`
+	Directory        string   `yaml:"directory"`
+	Allowed          []string `yaml:"allowed"`
+	Ignored          []string `yaml:"ignored"`
+	UpdateTypes      []string `yaml:"update_types"`
+	Schedule         Schedule `yaml:"schedule"`
+	TargetBranch     string   `yaml:"target_branch"`
+	PRTitleTemplate  string   `yaml:"pr_title_template"`
+	PRBodyTemplate   string   `yaml:"pr_body_template"`
+}
+
+// Config is the parsed content of `.gemnasium/config.yml`.
+type Config struct {
+	Version int             `yaml:"version"`
+	Updates []EcosystemRule `yaml:"updates"`
+}
+
+// Load reads and parses the configuration file at path. A missing file is
+// not an error: it returns an empty Config so callers can fall back to
+// "no restrictions".
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// RuleFor returns the EcosystemRule declared for the given package
+// ecosystem, or nil if none was declared (meaning: no restrictions).
+func (c *Config) RuleFor(packageEcosystem string) *EcosystemRule {
+	for i := range c.Updates {
+		if c.Updates[i].PackageEcosystem == packageEcosystem {
+			return &c.Updates[i]
+		}
+	}
+	return nil
+}
+
+// Allows reports whether packageName/bump is permitted by the rule: it must
+// not match an ignore glob, and, if allowed globs are declared, must match
+// one of them. If update_types is set, the bump must be no larger than the
+// largest "semver:" class listed there (so "semver:minor" also admits patch
+// bumps); an unrecognized bump class is never admitted.
+func (r *EcosystemRule) Allows(packageName, bump string) bool {
+	for _, pattern := range r.Ignored {
+		if ok, _ := filepath.Match(pattern, packageName); ok {
+			return false
+		}
+	}
+
+	if len(r.Allowed) > 0 {
+		matched := false
+		for _, pattern := range r.Allowed {
+			if ok, _ := filepath.Match(pattern, packageName); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.UpdateTypes) == 0 {
+		return true
+	}
+	rank := map[string]int{"patch": 1, "minor": 2, "major": 3}
+	if rank[bump] == 0 {
+		return false
+	}
+	for _, t := range r.UpdateTypes {
+		if strings.HasPrefix(t, "semver:") && rank[strings.TrimPrefix(t, "semver:")] >= rank[bump] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package autoupdate
+
+import "testing"
+
+func TestEcosystemRuleAllows(t *testing.T) {
+	cases := []struct {
+		name string
+		rule EcosystemRule
+		pkg  string
+		bump string
+		want bool
+	}{
+		{
+			name: "no restrictions",
+			rule: EcosystemRule{},
+			pkg:  "lodash",
+			bump: "major",
+			want: true,
+		},
+		{
+			name: "ignored package",
+			rule: EcosystemRule{Ignored: []string{"lodash"}},
+			pkg:  "lodash",
+			bump: "patch",
+			want: false,
+		},
+		{
+			name: "not in allowed list",
+			rule: EcosystemRule{Allowed: []string{"react*"}},
+			pkg:  "lodash",
+			bump: "patch",
+			want: false,
+		},
+		{
+			name: "bump within update_types",
+			rule: EcosystemRule{UpdateTypes: []string{"semver:patch"}},
+			pkg:  "lodash",
+			bump: "patch",
+			want: true,
+		},
+		{
+			name: "bump above update_types",
+			rule: EcosystemRule{UpdateTypes: []string{"semver:patch"}},
+			pkg:  "lodash",
+			bump: "major",
+			want: false,
+		},
+		{
+			name: "unknown bump class with update_types restriction",
+			rule: EcosystemRule{UpdateTypes: []string{"semver:patch"}},
+			pkg:  "lodash",
+			bump: "",
+			want: false,
+		},
+	}
+	for _, c := range cases {
+		if got := c.rule.Allows(c.pkg, c.bump); got != c.want {
+			t.Errorf("%s: Allows(%q, %q) = %v, want %v", c.name, c.pkg, c.bump, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Package repo wraps go-git to give the autoupdate loop a repo abstraction
+that doesn't depend on the `git` binary being on PATH. It opens the working
+repository once and lets callers checkpoint HEAD, branch off it per
+UpdateSet, commit the patched dependency files, and reset back to the
+checkpoint atomically between iterations.
+*/
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// defaultSignature is used when the repo has no user.name/user.email
+// configured (common in CI containers).
+var defaultSignature = object.Signature{
+	Name:  "gemnasium-autoupdate",
+	Email: "autoupdate@gemnasium.com",
+}
+
+// Repo is a thin, autoupdate-specific façade over a go-git repository.
+type Repo struct {
+	repo *git.Repository
+	wt   *git.Worktree
+	path string
+}
+
+// Open opens the git repository rooted at (or above) path.
+func Open(path string) (*Repo, error) {
+	gitRepo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, err
+	}
+	wt, err := gitRepo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	// Store an absolute path: Worktree() clones from it later, potentially
+	// from a goroutine that doesn't share the process's current working
+	// directory at that point (see autoupdate/concurrent.go), so a relative
+	// path here would be resolved against whatever cwd happens to be current
+	// at clone time instead of the directory Open was actually called with.
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Repo{repo: gitRepo, wt: wt, path: absPath}, nil
+}
+
+// Worktree clones the repository into dir and returns a Repo backed by that
+// clone. Running concurrent UpdateSets each against their own Worktree keeps
+// their patches from colliding in a single working tree. The clone tracks
+// the same branch r currently has checked out, so callers can later
+// CheckoutBranch back to it by name.
+func (r *Repo) Worktree(dir string) (*Repo, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	cloned, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:           r.path,
+		ReferenceName: head.Name(),
+		SingleBranch:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	wt, err := cloned.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	return &Repo{repo: cloned, wt: wt, path: dir}, nil
+}
+
+// Dir returns the working directory this Repo operates on.
+func (r *Repo) Dir() string {
+	return r.path
+}
+
+// HeadRevision returns the full SHA of HEAD.
+func (r *Repo) HeadRevision() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+// CurrentBranch returns the short name of the branch HEAD points to.
+func (r *Repo) CurrentBranch() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", err
+	}
+	if !head.Name().IsBranch() {
+		return "", errors.New("repo: HEAD is detached, not on a branch")
+	}
+	return head.Name().Short(), nil
+}
+
+// CheckoutNewBranch creates `name` at the current HEAD and switches the
+// worktree to it.
+func (r *Repo) CheckoutNewBranch(name string) error {
+	return r.wt.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(name),
+		Create: true,
+	})
+}
+
+// CheckoutBranch switches the worktree to the existing branch `name`,
+// without creating it.
+func (r *Repo) CheckoutBranch(name string) error {
+	return r.wt.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(name),
+	})
+}
+
+// DeleteBranch removes the local branch `name`. The branch must not be the
+// one currently checked out.
+func (r *Repo) DeleteBranch(name string) error {
+	return r.repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(name))
+}
+
+// Signature returns the repo's configured user.name/user.email, falling
+// back to a generic autoupdate identity when none is set.
+func (r *Repo) Signature() object.Signature {
+	cfg, err := r.repo.ConfigScoped(0)
+	if err != nil || cfg.User.Name == "" {
+		return defaultSignature
+	}
+	return object.Signature{Name: cfg.User.Name, Email: cfg.User.Email}
+}
+
+// CommitPaths stages exactly the given paths (relative to the repo root)
+// and commits them with msg, returning the new commit's hash.
+func (r *Repo) CommitPaths(paths []string, msg string, signature object.Signature) (plumbing.Hash, error) {
+	for _, path := range paths {
+		if _, err := r.wt.Add(path); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	signature.When = time.Now()
+	return r.wt.Commit(msg, &git.CommitOptions{Author: &signature})
+}
+
+// ResetHard discards any uncommitted changes and moves HEAD (and the
+// current branch, if any) back to ref.
+func (r *Repo) ResetHard(ref string) error {
+	return r.wt.Reset(&git.ResetOptions{
+		Commit: plumbing.NewHash(ref),
+		Mode:   git.HardReset,
+	})
+}
+
+// RemoteURL returns the fetch URL configured for remoteName.
+func (r *Repo) RemoteURL(remoteName string) (string, error) {
+	remote, err := r.repo.Remote(remoteName)
+	if err != nil {
+		return "", err
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", fmt.Errorf("repo: remote %q has no URL configured", remoteName)
+	}
+	return urls[0], nil
+}
+
+// Push pushes the local branch to remoteName (typically "origin"),
+// authenticating with username/password over HTTP basic auth when password
+// is non-empty (e.g. an HTTPS checkout with no credential helper configured).
+func (r *Repo) Push(remoteName, branch, username, password string) error {
+	refSpec := config.RefSpec(fmt.Sprintf("refs/heads/%s:refs/heads/%s", branch, branch))
+	pushOpts := &git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{refSpec},
+	}
+	if password != "" {
+		pushOpts.Auth = &githttp.BasicAuth{Username: username, Password: password}
+	}
+	err := r.repo.Push(pushOpts)
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}